@@ -4,12 +4,16 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -27,32 +31,54 @@ type LanguageConfig struct {
 	CompileArgs  []string
 	NeedsCompile bool
 	RunCompiled  bool
+	// Image is the container image DockerExecutor runs this language in.
+	// DockerExecutor rejects languages whose Image is empty; NsjailExecutor
+	// does not use it.
+	Image string
+	// Installer runs before execution when the "dependencies" argument is
+	// set. "{manifest}" and "{deps}" are substituted with the materialized
+	// manifest file's path and the cache dir packages are installed into.
+	// Empty means this language doesn't support dependency installation.
+	Installer []string
+	// ManifestFile is the filename the "dependencies" manifest is written
+	// as, e.g. "requirements.txt" or "package.json".
+	ManifestFile string
 }
 
 var languageConfigs = map[string]LanguageConfig{
-	"python":     {Cmd: "python3", Extension: ".py"},
-	"python2":    {Cmd: "python2", Extension: ".py"},
-	"javascript": {Cmd: "node", Extension: ".js"},
-	"typescript": {Cmd: "ts-node", Extension: ".ts"},
-	"go":         {Cmd: "go", Args: []string{"run"}, Extension: ".go"},
-	"rust":       {Cmd: "rustc", Extension: ".rs", NeedsCompile: true, RunCompiled: true},
-	"java":       {Cmd: "javac", Extension: ".java", NeedsCompile: true, RunCompiled: true},
-	"c":          {Cmd: "gcc", CompileArgs: []string{"-o"}, Extension: ".c", NeedsCompile: true, RunCompiled: true},
-	"cpp":        {Cmd: "g++", CompileArgs: []string{"-o"}, Extension: ".cpp", NeedsCompile: true, RunCompiled: true},
-	"ruby":       {Cmd: "ruby", Extension: ".rb"},
-	"php":        {Cmd: "php", Extension: ".php"},
-	"perl":       {Cmd: "perl", Extension: ".pl"},
-	"r":          {Cmd: "Rscript", Extension: ".r"},
-	"lua":        {Cmd: "lua", Extension: ".lua"},
-	"bash":       {Cmd: "bash", Extension: ".sh"},
-	"shell":      {Cmd: "sh", Extension: ".sh"},
-	"kotlin":     {Cmd: "kotlinc", Args: []string{"-script"}, Extension: ".kts"},
-	"scala":      {Cmd: "scala", Extension: ".scala"},
-	"swift":      {Cmd: "swift", Extension: ".swift"},
-	"dart":       {Cmd: "dart", Extension: ".dart"},
+	"python": {Cmd: "python3", Extension: ".py", Image: "python:3.12-slim",
+		Installer:    []string{"pip", "install", "--target", "{deps}", "-r", "{manifest}"},
+		ManifestFile: "requirements.txt"},
+	"python2": {Cmd: "python2", Extension: ".py"},
+	"javascript": {Cmd: "node", Extension: ".js", Image: "node:20-slim",
+		Installer:    []string{"npm", "install", "--prefix", "{deps}"},
+		ManifestFile: "package.json"},
+	"typescript": {Cmd: "ts-node", Extension: ".ts", Image: "node:20-slim",
+		Installer:    []string{"npm", "install", "--prefix", "{deps}"},
+		ManifestFile: "package.json"},
+	// go and rust deliberately have no Installer/ManifestFile: the run step
+	// invokes "go run"/"rustc" directly on a loose temp file with no
+	// surrounding module, so there is nowhere for a downloaded dependency to
+	// be resolved from. Revisit once the run step materializes a real
+	// module/crate for these languages.
+	"go":     {Cmd: "go", Args: []string{"run"}, Extension: ".go", Image: "golang:1.22"},
+	"rust":   {Cmd: "rustc", Extension: ".rs", NeedsCompile: true, RunCompiled: true, Image: "rust:1.78-slim"},
+	"java":   {Cmd: "javac", Extension: ".java", NeedsCompile: true, RunCompiled: true, Image: "eclipse-temurin:21-jdk"},
+	"c":      {Cmd: "gcc", CompileArgs: []string{"-o"}, Extension: ".c", NeedsCompile: true, RunCompiled: true, Image: "gcc:13"},
+	"cpp":    {Cmd: "g++", CompileArgs: []string{"-o"}, Extension: ".cpp", NeedsCompile: true, RunCompiled: true, Image: "gcc:13"},
+	"ruby":   {Cmd: "ruby", Extension: ".rb", Image: "ruby:3.3-slim"},
+	"php":    {Cmd: "php", Extension: ".php", Image: "php:8.3-cli"},
+	"perl":   {Cmd: "perl", Extension: ".pl"},
+	"r":      {Cmd: "Rscript", Extension: ".r"},
+	"lua":    {Cmd: "lua", Extension: ".lua"},
+	"bash":   {Cmd: "bash", Extension: ".sh"},
+	"shell":  {Cmd: "sh", Extension: ".sh"},
+	"kotlin": {Cmd: "kotlinc", Args: []string{"-script"}, Extension: ".kts"},
+	"scala":  {Cmd: "scala", Extension: ".scala"},
+	"swift":  {Cmd: "swift", Extension: ".swift"},
+	"dart":   {Cmd: "dart", Extension: ".dart"},
 }
 
-// --- Server Detection ---
 // --- Server Detection ---
 var serverRegexes = []*regexp.Regexp{
 	regexp.MustCompile(`(?i)listening`),
@@ -80,31 +106,582 @@ func looksLikeServerOutput(s string) bool {
 
 // --- Result Struct ---
 type CodeRunResult struct {
-	Success  bool   `json:"success"`
-	Output   string `json:"output"`
-	Error    string `json:"error,omitempty"`
-	ExitCode int    `json:"exitCode"`
-	Duration string `json:"duration"`
-	Command  string `json:"command"`
+	Success bool   `json:"success"`
+	Output  string `json:"output"`
+	Error   string `json:"error,omitempty"`
+	// InstallOutput is the dependency installer's combined stdout/stderr,
+	// set only when the "dependencies" argument triggered an install.
+	InstallOutput string `json:"installOutput,omitempty"`
+	ExitCode      int    `json:"exitCode"`
+	Duration      string `json:"duration"`
+	Command       string `json:"command"`
+}
+
+// --- Sandboxing ---
+
+// SandboxKind selects which Executor runs the user's code.
+type SandboxKind string
+
+const (
+	SandboxNone   SandboxKind = "none"
+	SandboxDocker SandboxKind = "docker"
+	SandboxNsjail SandboxKind = "nsjail"
+)
+
+// SandboxLimits caps the resources a sandboxed run may consume. Zero values
+// fall back to sandboxDefaultLimits. DockerExecutor applies all three;
+// NsjailExecutor applies only Pids.
+type SandboxLimits struct {
+	Memory string // docker --memory syntax, e.g. "512m"
+	CPUs   string // docker --cpus syntax, e.g. "1.0"
+	Pids   int    // docker --pids-limit / nsjail --rlimit_nproc
+}
+
+var sandboxDefaultLimits = SandboxLimits{Memory: "512m", CPUs: "1.0", Pids: 128}
+
+// ExecSpec is the fully-resolved description of a single run, produced by
+// Executor.Prepare and consumed by Executor.Run.
+type ExecSpec struct {
+	Cmd      *exec.Cmd
+	Kill     func()       // tears down the run; nil means use the process-group default
+	Stdin    io.Reader    // piped to the process once and closed; nil means no stdin
+	Progress ProgressFunc // if set, called with incremental output as the run progresses
+	Display  string       // human-readable command string for CodeRunResult.Command
+	Bin      string       // compiled binary to remove once the run is over; empty if nothing was compiled
+	StageDir string       // per-run staging directory to remove once the run is over; empty if none was created
+}
+
+// ProgressFunc receives incremental stdout/stderr as a run progresses. seq
+// increases by one on every call, for clients that order notifications by
+// sequence number rather than arrival time.
+type ProgressFunc func(seq int, chunk string)
+
+// mcpServer is set once in main so run-time helpers like sendProgress can
+// push notifications outside the request/response flow that mcp-go's tool
+// handlers otherwise confine them to.
+var mcpServer *server.MCPServer
+
+// sendProgress emits a notifications/progress message carrying the next
+// chunk of a streamed run. Failures are swallowed: a dropped progress update
+// isn't worth failing the run over, and the final result still carries the
+// full output regardless.
+func sendProgress(ctx context.Context, token mcp.ProgressToken, seq int, chunk string) {
+	if mcpServer == nil {
+		return
+	}
+	_ = mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+		"progressToken": token,
+		"progress":      float64(seq),
+		"message":       chunk,
+	})
+}
+
+// Executor prepares and runs a single piece of user code. HostExecutor runs
+// directly on the machine; DockerExecutor and NsjailExecutor isolate the run.
+type Executor interface {
+	Prepare(ctx context.Context, lang, target string, config LanguageConfig) (*ExecSpec, error)
+	Run(ctx context.Context, spec *ExecSpec, timeout time.Duration) *CodeRunResult
+}
+
+// HostExecutor runs the interpreter/compiler directly on the host, compiling
+// first when the language requires it. This is the original run_code
+// behavior and remains the default.
+type HostExecutor struct{}
+
+func (HostExecutor) Prepare(ctx context.Context, lang, target string, config LanguageConfig) (*ExecSpec, error) {
+	var cmd *exec.Cmd
+	if config.NeedsCompile {
+		bin := filepath.Join(os.TempDir(), fmt.Sprintf("mcp-bin-%d", time.Now().UnixNano()))
+		compile := exec.CommandContext(ctx, config.Cmd, append(config.CompileArgs, bin, target)...)
+		if out, err := runAndCollect(ctx, compile); err != nil {
+			return nil, fmt.Errorf("compile failed: %s", string(out))
+		}
+		cmd = exec.CommandContext(ctx, bin)
+		return &ExecSpec{Cmd: cmd, Display: strings.Join(cmd.Args, " "), Bin: bin}, nil
+	}
+	cmd = exec.CommandContext(ctx, config.Cmd, append(config.Args, target)...)
+	return &ExecSpec{Cmd: cmd, Display: strings.Join(cmd.Args, " ")}, nil
+}
+
+func (HostExecutor) Run(ctx context.Context, spec *ExecSpec, timeout time.Duration) *CodeRunResult {
+	return runCommandWithDetection(ctx, spec.Cmd, timeout, spec.Display, spec.Kill, spec.Stdin, spec.Progress)
+}
+
+// stageSourceForSandbox copies target into a fresh directory of its own, so
+// that bind-mounting "the run's directory" into a sandbox doesn't also hand
+// it every other request's source file and compiled artifacts sitting next
+// to it in the shared OS temp dir. Returns the new directory, which the
+// caller owns and must remove once the run is over.
+func stageSourceForSandbox(target string) (string, error) {
+	dir, err := os.MkdirTemp("", "lattice-sandbox-*")
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(target))
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// DockerExecutor runs the target inside a throwaway container: no network,
+// a read-only rootfs, and the source bind-mounted in. Detection and timeout
+// handling are unchanged; only the kill path differs (`docker kill` instead
+// of killing the host process group).
+type DockerExecutor struct {
+	Limits SandboxLimits
+}
+
+func (d DockerExecutor) limits() SandboxLimits {
+	l := d.Limits
+	if l.Memory == "" {
+		l.Memory = sandboxDefaultLimits.Memory
+	}
+	if l.CPUs == "" {
+		l.CPUs = sandboxDefaultLimits.CPUs
+	}
+	if l.Pids == 0 {
+		l.Pids = sandboxDefaultLimits.Pids
+	}
+	return l
+}
+
+func (d DockerExecutor) Prepare(ctx context.Context, lang, target string, config LanguageConfig) (*ExecSpec, error) {
+	if config.Image == "" {
+		return nil, fmt.Errorf("no docker image configured for language: %s", lang)
+	}
+	if config.NeedsCompile {
+		return nil, fmt.Errorf("docker sandbox does not yet support compiled language: %s", lang)
+	}
+
+	limits := d.limits()
+	stageDir, err := stageSourceForSandbox(target)
+	if err != nil {
+		return nil, fmt.Errorf("staging source for sandbox: %w", err)
+	}
+	name := fmt.Sprintf("lattice-run-%d", time.Now().UnixNano())
+
+	args := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"--network", "none",
+		"--read-only",
+		"--memory", limits.Memory,
+		"--cpus", limits.CPUs,
+		"--pids-limit", strconv.Itoa(limits.Pids),
+		"--tmpfs", "/tmp",
+		"-v", fmt.Sprintf("%s:/workspace:ro", stageDir),
+		"-w", "/workspace",
+		config.Image,
+		config.Cmd,
+	}
+	args = append(args, config.Args...)
+	args = append(args, filepath.Base(target))
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	kill := func() { _, _ = runAndCollect(context.Background(), exec.Command("docker", "kill", name)) }
+	return &ExecSpec{Cmd: cmd, Kill: kill, Display: strings.Join(cmd.Args, " "), StageDir: stageDir}, nil
+}
+
+func (d DockerExecutor) Run(ctx context.Context, spec *ExecSpec, timeout time.Duration) *CodeRunResult {
+	return runCommandWithDetection(ctx, spec.Cmd, timeout, spec.Display, spec.Kill, spec.Stdin, spec.Progress)
+}
+
+// NsjailExecutor runs the target under nsjail for namespace/cgroup isolation
+// without the overhead of a container image. It still executes on the host
+// process tree, so teardown reuses the default process-group kill.
+type NsjailExecutor struct {
+	Limits SandboxLimits
+}
+
+func (n NsjailExecutor) limits() SandboxLimits {
+	l := n.Limits
+	if l.Memory == "" {
+		l.Memory = sandboxDefaultLimits.Memory
+	}
+	if l.Pids == 0 {
+		l.Pids = sandboxDefaultLimits.Pids
+	}
+	return l
+}
+
+func (n NsjailExecutor) Prepare(ctx context.Context, lang, target string, config LanguageConfig) (*ExecSpec, error) {
+	if config.NeedsCompile {
+		return nil, fmt.Errorf("nsjail sandbox does not yet support compiled language: %s", lang)
+	}
+	limits := n.limits()
+	stageDir, err := stageSourceForSandbox(target)
+	if err != nil {
+		return nil, fmt.Errorf("staging source for sandbox: %w", err)
+	}
+
+	args := []string{
+		"--mode", "o",
+		"--rlimit_as", "hard",
+		"--rlimit_nproc", strconv.Itoa(limits.Pids),
+		"--disable_clone_newnet=false",
+		"--bindmount_ro", stageDir + ":/workspace",
+		"--cwd", "/workspace",
+		"--",
+		config.Cmd,
+	}
+	args = append(args, config.Args...)
+	args = append(args, filepath.Base(target))
+
+	cmd := exec.CommandContext(ctx, "nsjail", args...)
+	return &ExecSpec{Cmd: cmd, Display: strings.Join(cmd.Args, " "), StageDir: stageDir}, nil
+}
+
+func (n NsjailExecutor) Run(ctx context.Context, spec *ExecSpec, timeout time.Duration) *CodeRunResult {
+	return runCommandWithDetection(ctx, spec.Cmd, timeout, spec.Display, spec.Kill, spec.Stdin, spec.Progress)
+}
+
+func executorFor(kind SandboxKind) Executor {
+	switch kind {
+	case SandboxDocker:
+		return DockerExecutor{}
+	case SandboxNsjail:
+		return NsjailExecutor{}
+	default:
+		return HostExecutor{}
+	}
+}
+
+// --- Server Sessions ---
+// start_server keeps a process alive past the call that launched it instead
+// of killing it the moment looksLikeServerOutput fires. Each launch is
+// tracked as a ServerSession so later calls can tail its logs or stop it.
+
+const sessionLogCap = 64 * 1024 // bytes of combined stdout/stderr kept per session
+
+// ringBuffer is an append-only byte buffer capped at sessionLogCap, dropping
+// the oldest bytes once full.
+type ringBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, p...)
+	if over := len(r.buf) - sessionLogCap; over > 0 {
+		r.buf = r.buf[over:]
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n bytes, or everything if n exceeds the buffer.
+func (r *ringBuffer) Tail(n int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n <= 0 || n > len(r.buf) {
+		n = len(r.buf)
+	}
+	return string(r.buf[len(r.buf)-n:])
+}
+
+// ServerSession is one long-running process started via start_server or
+// run_code's mode:"server".
+type ServerSession struct {
+	ID      string
+	Command string
+	Started time.Time
+
+	cmd       *exec.Cmd
+	kill      func()
+	buf       *ringBuffer
+	tempFile  string
+	bin       string
+	stageDir  string
+	exitedCh  chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	port    string
+	exited  bool
+	exitErr error
+}
+
+// Port returns the port detected in the session's output so far, or "" if
+// none has been seen yet.
+func (s *ServerSession) Port() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.port
+}
+
+// setPort records the detected port, guarded the same way exited/exitErr
+// are since it's written from the stdout/stderr reader goroutines and read
+// from request handlers.
+func (s *ServerSession) setPort(port string) {
+	s.mu.Lock()
+	s.port = port
+	s.mu.Unlock()
+}
+
+func (s *ServerSession) markExited(err error) {
+	s.mu.Lock()
+	s.exited = true
+	s.exitErr = err
+	s.mu.Unlock()
+	s.closeOnce.Do(func() { close(s.exitedCh) })
+	if s.tempFile != "" {
+		os.Remove(s.tempFile)
+	}
+	if s.bin != "" {
+		os.Remove(s.bin)
+	}
+	if s.stageDir != "" {
+		os.RemoveAll(s.stageDir)
+	}
+}
+
+// Status reports "running" or the terminal state of an exited process.
+func (s *ServerSession) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exited {
+		return "running"
+	}
+	if s.exitErr != nil {
+		return fmt.Sprintf("exited: %v", s.exitErr)
+	}
+	return "exited"
+}
+
+// Stop asks the process to shut down gracefully (SIGTERM to its process
+// group, when we own it) and escalates to the hard kill after grace if it
+// hasn't exited by then. Sessions whose ExecSpec brought its own Kill (the
+// docker sandbox) have no process group of ours to signal, so they go
+// straight to that Kill.
+func (s *ServerSession) Stop(grace time.Duration) {
+	s.mu.Lock()
+	exited := s.exited
+	s.mu.Unlock()
+	if exited {
+		return
+	}
+
+	ownsProcessGroup := s.cmd.SysProcAttr != nil && s.cmd.SysProcAttr.Setpgid
+	if ownsProcessGroup && s.cmd.Process != nil {
+		_ = syscall.Kill(-s.cmd.Process.Pid, syscall.SIGTERM)
+		select {
+		case <-s.exitedCh:
+			return
+		case <-time.After(grace):
+		}
+	}
+	s.kill()
+	<-s.exitedCh
+}
+
+// SessionManager owns every ServerSession started so far, keyed by id;
+// sessions stay listed after they exit.
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*ServerSession
+}
+
+var sessions = &SessionManager{sessions: map[string]*ServerSession{}}
+
+func (m *SessionManager) add(s *ServerSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = s
+}
+
+func (m *SessionManager) get(id string) (*ServerSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+func (m *SessionManager) list() []*ServerSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*ServerSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		out = append(out, s)
+	}
+	return out
+}
+
+var portRegex = regexp.MustCompile(`:(\d{2,5})\b`)
+
+func extractPort(s string) string {
+	if m := portRegex.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// startServerSession launches spec and blocks until either server output is
+// detected, readyTimeout elapses, or the process exits on its own — then
+// returns, leaving the process running in the background under sessions.
+// tempFile, if set, is removed once the session exits (it can't be cleaned
+// up when the call returns like the non-server path does, since the server
+// may still be reading from it). spec.Stdin, if set, is copied to the
+// process and the pipe is closed at EOF.
+func startServerSession(ctx context.Context, spec *ExecSpec, readyTimeout time.Duration, tempFile string) (*ServerSession, error) {
+	cmd := spec.Cmd
+	kill := spec.Kill
+	if kill == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	cmd.Stdin = spec.Stdin
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if kill == nil {
+		pid := cmd.Process.Pid
+		kill = func() { _ = syscall.Kill(-pid, syscall.SIGKILL) }
+	}
+
+	session := &ServerSession{
+		ID:       fmt.Sprintf("sess-%d", time.Now().UnixNano()),
+		Command:  spec.Display,
+		Started:  time.Now(),
+		cmd:      cmd,
+		kill:     kill,
+		buf:      &ringBuffer{},
+		tempFile: tempFile,
+		bin:      spec.Bin,
+		stageDir: spec.StageDir,
+		exitedCh: make(chan struct{}),
+	}
+
+	ready := make(chan struct{}, 1)
+	var readyOnce sync.Once
+	signalReady := func() { readyOnce.Do(func() { close(ready) }) }
+
+	readFromStream := func(stream io.Reader) {
+		tmp := make([]byte, 1024)
+		for {
+			n, err := stream.Read(tmp)
+			if n > 0 {
+				chunk := tmp[:n]
+				session.buf.Write(chunk)
+				if session.Port() == "" && looksLikeServerOutput(string(chunk)) {
+					session.setPort(extractPort(string(chunk)))
+					signalReady()
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	go readFromStream(stdout)
+	go readFromStream(stderr)
+
+	go func() {
+		err := <-waitForExit(context.Background(), cmd)
+		session.markExited(err)
+		signalReady()
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(readyTimeout):
+	case <-ctx.Done():
+		kill()
+		return nil, ctx.Err()
+	}
+
+	sessions.add(session)
+	return session, nil
 }
 
 // --- Core Execution ---
-func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, cmdStr string) *CodeRunResult {
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+// progressFlushBytes and progressFlushInterval bound how often progress, if
+// set, is called: whichever threshold is hit first triggers a flush of the
+// output accumulated since the last one.
+const progressFlushBytes = 4096
+const progressFlushInterval = 250 * time.Millisecond
+
+// runCommandWithDetection starts cmd, streams its combined stdout/stderr, and
+// returns as soon as the process exits, a server is detected, or timeout
+// elapses. kill tears the run down on context cancellation, server
+// detection, or timeout; if nil it kills cmd's own process group, which is
+// correct for anything started directly on the host. If stdin is non-nil it
+// is copied to the process once and the pipe is closed on EOF or context
+// cancellation. If progress is non-nil it receives incremental output
+// roughly every progressFlushBytes or progressFlushInterval, whichever
+// comes first; the final CodeRunResult still carries the full aggregated
+// output regardless, for callers that ignore progress.
+func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, cmdStr string, kill func(), stdin io.Reader, progress ProgressFunc) *CodeRunResult {
+	if kill == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
 
+	var stdinPipe io.WriteCloser
+	if stdin != nil {
+		stdinPipe, _ = cmd.StdinPipe()
+	}
+
 	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		return &CodeRunResult{Success: false, Error: err.Error(), Command: cmdStr}
 	}
 
+	if kill == nil {
+		pid := cmd.Process.Pid
+		kill = func() { _ = syscall.Kill(-pid, syscall.SIGKILL) }
+	}
+
+	if stdinPipe != nil {
+		go func() {
+			defer stdinPipe.Close()
+			done := make(chan struct{})
+			go func() {
+				io.Copy(stdinPipe, stdin)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
 	var buf bytes.Buffer
 	serverDetected := make(chan struct{}, 1)
 	done := make(chan error, 1)
 
 	// Read from stdout and stderr in separate goroutines to avoid blocking
 	bufMutex := &sync.Mutex{}
+	lastFlush := 0
+	seq := 0
+	flush := func() {
+		if progress == nil {
+			return
+		}
+		bufMutex.Lock()
+		if buf.Len() <= lastFlush {
+			bufMutex.Unlock()
+			return
+		}
+		chunk := string(buf.Bytes()[lastFlush:])
+		lastFlush = buf.Len()
+		seq++
+		s := seq
+		bufMutex.Unlock()
+		progress(s, chunk)
+	}
+
 	readFromStream := func(stream io.Reader) {
 		tmp := make([]byte, 1024)
 		for {
@@ -119,6 +696,7 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 				bufMutex.Lock()
 				buf.WriteString(chunk)
 				shouldCheck := looksLikeServerOutput(chunk)
+				shouldFlush := progress != nil && buf.Len()-lastFlush >= progressFlushBytes
 				bufMutex.Unlock()
 
 				if shouldCheck {
@@ -129,6 +707,9 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 					default:
 					}
 				}
+				if shouldFlush {
+					flush()
+				}
 			}
 			if err != nil {
 				return
@@ -139,19 +720,32 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 	go readFromStream(stdout)
 	go readFromStream(stderr)
 
+	if progress != nil {
+		ticker := time.NewTicker(progressFlushInterval)
+		stopTicker := make(chan struct{})
+		defer func() { close(stopTicker) }()
+		defer ticker.Stop()
+		defer flush()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					flush()
+				case <-stopTicker:
+					return
+				}
+			}
+		}()
+	}
+
 	go func() {
-		select {
-		case done <- cmd.Wait():
-		case <-ctx.Done():
-			// Context cancelled, don't block on Wait()
-			done <- fmt.Errorf("context cancelled")
-		}
+		done <- <-waitForExit(ctx, cmd)
 	}()
 
 	select {
 	case <-ctx.Done():
 		// Context cancellation has highest priority
-		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		kill()
 		stdout.Close()
 		stderr.Close()
 		// Give a small timeout for goroutines to finish, but don't block indefinitely
@@ -163,7 +757,7 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 		}
 
 	case <-serverDetected:
-		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		kill()
 		stdout.Close()
 		stderr.Close()
 		// Don't use fmt.Println here - stdout is used for MCP protocol communication
@@ -176,7 +770,7 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 		}
 
 	case <-time.After(timeout):
-		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		kill()
 		stdout.Close()
 		stderr.Close()
 		return &CodeRunResult{
@@ -209,28 +803,125 @@ func runCommandWithDetection(ctx context.Context, cmd *exec.Cmd, timeout time.Du
 	}
 }
 
-func runCode(ctx context.Context, params mcp.CallToolParams) (*CodeRunResult, error) {
-	args := params.Arguments.(map[string]any)
-	lang := args["language"].(string)
+// resolveLanguage pulls the required "language" argument and its config out
+// of a tool call's arguments.
+func resolveLanguage(args map[string]any) (string, LanguageConfig, error) {
+	lang, _ := args["language"].(string)
 	config, ok := languageConfigs[lang]
 	if !ok {
-		return nil, fmt.Errorf("unsupported language: %s", lang)
+		return "", LanguageConfig{}, fmt.Errorf("unsupported language: %s", lang)
 	}
+	return lang, config, nil
+}
 
-	timeout := 10 * time.Second
-	if t, ok := args["timeout"].(float64); ok {
-		timeout = time.Duration(int(t)) * time.Second
+func resolveSandbox(args map[string]any) (Executor, error) {
+	sandbox := SandboxNone
+	if s, ok := args["sandbox"].(string); ok && s != "" {
+		switch SandboxKind(s) {
+		case SandboxDocker, SandboxNsjail, SandboxNone:
+			sandbox = SandboxKind(s)
+		default:
+			return nil, fmt.Errorf("unknown sandbox: %s", s)
+		}
 	}
+	return executorFor(sandbox), nil
+}
 
-	// Use the passed context, but ensure it has at least the timeout duration
-	// If the context already has a shorter deadline, respect it
-	ctxDeadline, hasDeadline := ctx.Deadline()
-	if !hasDeadline || time.Until(ctxDeadline) > timeout {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
-		defer cancel()
+// --- Dependency Installation ---
+
+// depEnvVar is the environment variable each language's toolchain reads to
+// resolve imports against an installed-dependencies directory instead of
+// its normal system location.
+var depEnvVar = map[string]string{
+	"python":     "PYTHONPATH",
+	"javascript": "NODE_PATH",
+	"typescript": "NODE_PATH",
+}
+
+// depEnvPath returns the directory a language's dependency env var should
+// actually point at. This isn't always depsDir itself: npm installs into
+// depsDir/node_modules, and NODE_PATH resolution checks <entry>/pkg
+// directly rather than <entry>/node_modules/pkg, so require() needs the
+// node_modules subdirectory, not depsDir.
+func depEnvPath(lang, depsDir string) string {
+	switch lang {
+	case "javascript", "typescript":
+		return filepath.Join(depsDir, "node_modules")
+	default:
+		return depsDir
+	}
+}
+
+// manifestFromNames turns a plain package-name list into the manifest
+// format each language's installer expects.
+func manifestFromNames(lang string, names []string) string {
+	switch lang {
+	case "javascript", "typescript":
+		deps := make(map[string]string, len(names))
+		for _, n := range names {
+			deps[n] = "*"
+		}
+		b, _ := json.Marshal(map[string]any{"name": "mcp-run", "version": "0.0.0", "dependencies": deps})
+		return string(b)
+	default: // python and anything else that takes a line-per-package manifest
+		return strings.Join(names, "\n") + "\n"
+	}
+}
+
+// installDeps materializes manifest into config's per-language cache dir,
+// keyed by the manifest's sha256 so identical manifests are installed once,
+// and runs config.Installer against it unless an earlier install into that
+// cache dir completed (left its .installed marker). Returns the cache dir (exported to the run via depEnvVar) and
+// the installer's combined output.
+func installDeps(ctx context.Context, lang string, config LanguageConfig, manifest string, timeout time.Duration) (depsDir string, output string, err error) {
+	if len(config.Installer) == 0 {
+		return "", "", fmt.Errorf("no dependency installer configured for language: %s", lang)
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(manifest))
+	depsDir = filepath.Join(base, "lattice-code-runner", lang, hex.EncodeToString(sum[:]))
+
+	marker := filepath.Join(depsDir, ".installed")
+	if _, statErr := os.Stat(marker); statErr == nil {
+		return depsDir, "", nil // already installed for this exact manifest
+	}
+	if err := os.MkdirAll(depsDir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	manifestPath := filepath.Join(depsDir, config.ManifestFile)
+	if err := os.WriteFile(manifestPath, []byte(manifest), 0o644); err != nil {
+		return "", "", err
 	}
 
+	installCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := make([]string, len(config.Installer))
+	for i, a := range config.Installer {
+		a = strings.ReplaceAll(a, "{deps}", depsDir)
+		a = strings.ReplaceAll(a, "{manifest}", manifestPath)
+		args[i] = a
+	}
+	install := exec.CommandContext(installCtx, args[0], args[1:]...)
+	install.Dir = depsDir
+	out, runErr := runAndCollect(installCtx, install)
+	if runErr != nil {
+		return depsDir, string(out), fmt.Errorf("dependency install failed: %w", runErr)
+	}
+	_ = os.WriteFile(marker, nil, 0o644)
+	return depsDir, string(out), nil
+}
+
+// buildExecSpec resolves the code/path/file arguments to a target on disk,
+// runs it through the executor's Prepare, and wires up stdin. tempFile is
+// set when "code" produced a temp source file; callers that don't hand the
+// spec off to a long-lived session should defer its removal.
+func buildExecSpec(ctx context.Context, executor Executor, args map[string]any, lang string, config LanguageConfig) (spec *ExecSpec, tempFile string, err error) {
 	path, _ := args["path"].(string)
 	file, _ := args["file"].(string)
 	code, _ := args["code"].(string)
@@ -238,36 +929,270 @@ func runCode(ctx context.Context, params mcp.CallToolParams) (*CodeRunResult, er
 	var target string
 	if code != "" {
 		tmp, _ := os.CreateTemp("", fmt.Sprintf("mcp-%s-*%s", lang, config.Extension))
-		defer os.Remove(tmp.Name())
 		tmp.WriteString(code)
 		tmp.Close()
 		target = tmp.Name()
+		tempFile = tmp.Name()
+	} else if path != "" && file != "" {
+		target = filepath.Join(path, file)
 	} else {
-		if path != "" && file != "" {
-			target = filepath.Join(path, file)
-		} else {
-			target = path
+		target = path
+	}
+
+	spec, err = executor.Prepare(ctx, lang, target, config)
+	if err != nil {
+		if tempFile != "" {
+			os.Remove(tempFile)
 		}
+		return nil, "", err
 	}
 
-	var cmd *exec.Cmd
-	if config.NeedsCompile {
-		bin := filepath.Join(os.TempDir(), fmt.Sprintf("mcp-bin-%d", time.Now().UnixNano()))
-		defer os.Remove(bin)
-		compile := exec.CommandContext(ctx, config.Cmd, append(config.CompileArgs, bin, target)...)
-		if out, err := compile.CombinedOutput(); err != nil {
-			return &CodeRunResult{Success: false, Error: string(out)}, nil
+	if stdin, ok := args["stdin"].(string); ok && stdin != "" {
+		spec.Stdin = strings.NewReader(stdin)
+	} else if stdinFile, ok := args["stdinFile"].(string); ok && stdinFile != "" {
+		f, openErr := os.Open(stdinFile)
+		if openErr != nil {
+			if tempFile != "" {
+				os.Remove(tempFile)
+			}
+			return nil, "", fmt.Errorf("stdinFile: %w", openErr)
 		}
-		cmd = exec.CommandContext(ctx, bin)
+		spec.Stdin = f
+	}
+	return spec, tempFile, nil
+}
+
+func runCode(ctx context.Context, params mcp.CallToolParams) (*CodeRunResult, error) {
+	args := params.Arguments.(map[string]any)
+	lang, config, err := resolveLanguage(args)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := resolveSandbox(args)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+	if t, ok := args["timeout"].(float64); ok {
+		timeout = time.Duration(int(t)) * time.Second
+	}
+
+	serverMode := false
+	if m, ok := args["mode"].(string); ok && m == "server" {
+		serverMode = true
+	}
+
+	// Server mode keeps the process alive past this call, so it must not
+	// inherit a context that we cancel on return. Everything else keeps the
+	// original behavior: use the passed context, but ensure it has at least
+	// the timeout duration, respecting a shorter deadline if already set.
+	runCtx := ctx
+	if serverMode {
+		runCtx = context.Background()
 	} else {
-		cmd = exec.CommandContext(ctx, config.Cmd, append(config.Args, target)...)
+		ctxDeadline, hasDeadline := ctx.Deadline()
+		if !hasDeadline || time.Until(ctxDeadline) > timeout {
+			var cancel context.CancelFunc
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+
+	spec, tempFile, err := buildExecSpec(runCtx, executor, args, lang, config)
+	if err != nil {
+		return &CodeRunResult{Success: false, Error: err.Error()}, nil
 	}
-	return runCommandWithDetection(ctx, cmd, timeout, strings.Join(cmd.Args, " ")), nil
+	if tempFile != "" && !serverMode {
+		defer os.Remove(tempFile)
+	}
+	if spec.Bin != "" && !serverMode {
+		defer os.Remove(spec.Bin)
+	}
+	if spec.StageDir != "" && !serverMode {
+		defer os.RemoveAll(spec.StageDir)
+	}
+
+	if stream, ok := args["stream"].(bool); ok && stream && params.Meta != nil && params.Meta.ProgressToken != nil {
+		token := params.Meta.ProgressToken
+		spec.Progress = func(seq int, chunk string) { sendProgress(ctx, token, seq, chunk) }
+	}
+
+	var installOutput string
+	if manifest := dependenciesManifest(lang, args); manifest != "" {
+		installTimeout := 60 * time.Second
+		if t, ok := args["installTimeout"].(float64); ok {
+			installTimeout = time.Duration(int(t)) * time.Second
+		}
+		depsDir, out, err := installDeps(ctx, lang, config, manifest, installTimeout)
+		installOutput = out
+		if err != nil {
+			if tempFile != "" {
+				os.Remove(tempFile)
+			}
+			return &CodeRunResult{Success: false, Error: err.Error(), InstallOutput: installOutput}, nil
+		}
+		if envVar, ok := depEnvVar[lang]; ok {
+			spec.Cmd.Env = append(os.Environ(), envVar+"="+depEnvPath(lang, depsDir))
+		}
+	}
+
+	if serverMode {
+		session, err := startServerSession(runCtx, spec, timeout, tempFile)
+		if err != nil {
+			if tempFile != "" {
+				os.Remove(tempFile)
+			}
+			return &CodeRunResult{Success: false, Error: err.Error(), Command: spec.Display}, nil
+		}
+		return &CodeRunResult{
+			Success:       true,
+			Output:        fmt.Sprintf("session=%s port=%s\n%s", session.ID, session.Port(), session.buf.Tail(4096)),
+			Command:       spec.Display,
+			Duration:      time.Since(session.Started).String(),
+			InstallOutput: installOutput,
+		}, nil
+	}
+
+	result := executor.Run(runCtx, spec, timeout)
+	result.InstallOutput = installOutput
+	return result, nil
+}
+
+// acceptStringOrArray widens a property's declared schema type from plain
+// "string" to ["string", "array"], so clients that validate arguments
+// against the schema don't reject the list-of-package-names form that
+// dependenciesManifest also accepts.
+func acceptStringOrArray(schema map[string]any) {
+	schema["type"] = []string{"string", "array"}
+	schema["items"] = map[string]any{"type": "string"}
+}
+
+// dependenciesManifest reads the "dependencies" argument, which is either a
+// package-name list or a manifest string, and returns manifest text ready
+// to write to disk. Empty means no dependency install was requested.
+func dependenciesManifest(lang string, args map[string]any) string {
+	if deps, ok := args["dependencies"].([]any); ok && len(deps) > 0 {
+		names := make([]string, 0, len(deps))
+		for _, d := range deps {
+			if s, ok := d.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return manifestFromNames(lang, names)
+	}
+	if m, ok := args["dependencies"].(string); ok {
+		return m
+	}
+	return ""
+}
+
+// --- Server Session Tools ---
+
+type startServerResult struct {
+	ID      string `json:"id"`
+	Port    string `json:"port,omitempty"`
+	Command string `json:"command"`
+	Logs    string `json:"logs"`
+}
+
+func startServer(ctx context.Context, params mcp.CallToolParams) (*startServerResult, error) {
+	args := params.Arguments.(map[string]any)
+	lang, config, err := resolveLanguage(args)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := resolveSandbox(args)
+	if err != nil {
+		return nil, err
+	}
+
+	readyTimeout := 5 * time.Second
+	if t, ok := args["timeout"].(float64); ok {
+		readyTimeout = time.Duration(int(t)) * time.Second
+	}
+
+	spec, tempFile, err := buildExecSpec(context.Background(), executor, args, lang, config)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := startServerSession(context.Background(), spec, readyTimeout, tempFile)
+	if err != nil {
+		if tempFile != "" {
+			os.Remove(tempFile)
+		}
+		return nil, err
+	}
+	return &startServerResult{
+		ID:      session.ID,
+		Port:    session.Port(),
+		Command: session.Command,
+		Logs:    session.buf.Tail(4096),
+	}, nil
+}
+
+func stopServer(args map[string]any) (string, error) {
+	id, _ := args["id"].(string)
+	session, ok := sessions.get(id)
+	if !ok {
+		return "", fmt.Errorf("no such session: %s", id)
+	}
+	grace := 5 * time.Second
+	if g, ok := args["grace"].(float64); ok {
+		grace = time.Duration(g) * time.Second
+	}
+	session.Stop(grace)
+	return fmt.Sprintf("session %s stopped", id), nil
+}
+
+func listServers() string {
+	list := sessions.list()
+	if len(list) == 0 {
+		return "no active sessions"
+	}
+	var b strings.Builder
+	for _, s := range list {
+		fmt.Fprintf(&b, "%s\tport=%s\tstatus=%s\tstarted=%s\t%s\n",
+			s.ID, s.Port(), s.Status(), s.Started.Format(time.RFC3339), s.Command)
+	}
+	return b.String()
+}
+
+func tailLogs(ctx context.Context, args map[string]any) (string, error) {
+	id, _ := args["id"].(string)
+	session, ok := sessions.get(id)
+	if !ok {
+		return "", fmt.Errorf("no such session: %s", id)
+	}
+
+	n := 8192
+	if kb, ok := args["kb"].(float64); ok && kb > 0 {
+		n = int(kb) * 1024
+	}
+
+	if follow, ok := args["follow"].(bool); ok && follow {
+		followFor := 5 * time.Second
+		if s, ok := args["followSeconds"].(float64); ok && s > 0 {
+			followFor = time.Duration(s) * time.Second
+		}
+		followCtx, cancel := context.WithTimeout(ctx, followFor)
+		defer cancel()
+		select {
+		case <-session.exitedCh:
+		case <-followCtx.Done():
+		}
+	}
+
+	return session.buf.Tail(n), nil
 }
 
 // --- MCP Server ---
 func main() {
+	startReaper()
+
 	s := server.NewMCPServer("code-runner", "1.4.1", server.WithToolCapabilities(true))
+	mcpServer = s
 
 	runTool := mcp.NewTool("run_code",
 		mcp.WithDescription("Runs code in multiple languages; detects servers and terminates safely."),
@@ -276,6 +1201,13 @@ func main() {
 		mcp.WithString("file"),
 		mcp.WithString("code"),
 		mcp.WithNumber("timeout"),
+		mcp.WithString("sandbox", mcp.Description("Isolation backend: none (default), docker, or nsjail")),
+		mcp.WithString("stdin", mcp.Description("Text written to the process's stdin, then the pipe is closed")),
+		mcp.WithString("stdinFile", mcp.Description("Path to a file streamed to the process's stdin instead of stdin")),
+		mcp.WithString("mode", mcp.Description("\"server\" keeps the process alive and registers it with start_server's session manager instead of killing it on detection")),
+		mcp.WithString("dependencies", mcp.Description("A manifest to install before running: requirements.txt contents for python, package.json contents for javascript/typescript; a list of package names is also accepted. Other languages have no installer and return an error"), acceptStringOrArray),
+		mcp.WithNumber("installTimeout", mcp.Description("Seconds allowed for dependency installation before running the code (default 60)")),
+		mcp.WithBoolean("stream", mcp.Description("Emit notifications/progress updates as output arrives instead of waiting for completion; requires the caller to send a progress token")),
 	)
 
 	s.AddTool(runTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -291,6 +1223,61 @@ func main() {
 		return mcp.NewToolResultText(out), nil
 	})
 
+	startServerTool := mcp.NewTool("start_server",
+		mcp.WithDescription("Launches a long-running process (e.g. a dev server) and keeps it alive instead of killing it on detection."),
+		mcp.WithString("language", mcp.Required()),
+		mcp.WithString("path"),
+		mcp.WithString("file"),
+		mcp.WithString("code"),
+		mcp.WithNumber("timeout", mcp.Description("Seconds to wait for server-output detection before returning anyway (default 5)")),
+		mcp.WithString("sandbox", mcp.Description("Isolation backend: none (default), docker, or nsjail")),
+	)
+	s.AddTool(startServerTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		res, err := startServer(ctx, req.Params)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("session=%s port=%s\n%s\n\n--- Logs ---\n%s",
+			res.ID, res.Port, res.Command, res.Logs)), nil
+	})
+
+	stopServerTool := mcp.NewTool("stop_server",
+		mcp.WithDescription("Stops a session started by start_server (SIGTERM, then SIGKILL after a grace period)."),
+		mcp.WithString("id", mcp.Required()),
+		mcp.WithNumber("grace", mcp.Description("Seconds to wait after SIGTERM before force-killing (default 5)")),
+	)
+	s.AddTool(stopServerTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := req.Params.Arguments.(map[string]any)
+		msg, err := stopServer(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(msg), nil
+	})
+
+	listServersTool := mcp.NewTool("list_servers",
+		mcp.WithDescription("Lists sessions started by start_server, with id, port, status, and start time."),
+	)
+	s.AddTool(listServersTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(listServers()), nil
+	})
+
+	tailLogsTool := mcp.NewTool("tail_logs",
+		mcp.WithDescription("Returns the most recent output from a start_server session, optionally waiting for more."),
+		mcp.WithString("id", mcp.Required()),
+		mcp.WithNumber("kb", mcp.Description("How many KB of trailing output to return (default 8)")),
+		mcp.WithBoolean("follow", mcp.Description("Wait followSeconds, or until the session exits if sooner, before returning, so output produced meanwhile is included")),
+		mcp.WithNumber("followSeconds", mcp.Description("Bound on how long follow waits (default 5)")),
+	)
+	s.AddTool(tailLogsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := req.Params.Arguments.(map[string]any)
+		out, err := tailLogs(ctx, args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(out), nil
+	})
+
 	if err := server.ServeStdio(s); err != nil {
 		if strings.Contains(err.Error(), "broken pipe") {
 			fmt.Fprintln(os.Stderr, "⚠️ Client disconnected — exiting gracefully.")
@@ -0,0 +1,77 @@
+// path: reaper.go
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// childExit is what the platform reaper publishes once it collects a pid,
+// whether that pid is our own direct child or an orphan re-parented to us.
+type childExit struct {
+	ExitCode int
+	Err      error
+}
+
+// reaper fans exit notifications out to whoever is waiting on a given pid.
+// There is exactly one instance, globalReaper, shared by every run.
+type reaper struct {
+	mu      sync.Mutex
+	waiters map[int]chan childExit
+}
+
+var globalReaper = &reaper{waiters: map[int]chan childExit{}}
+
+// register returns a channel that receives exactly one childExit once pid
+// is collected.
+func (r *reaper) register(pid int) <-chan childExit {
+	ch := make(chan childExit, 1)
+	r.mu.Lock()
+	r.waiters[pid] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *reaper) publish(pid, exitCode int, err error) {
+	r.mu.Lock()
+	ch, ok := r.waiters[pid]
+	if ok {
+		delete(r.waiters, pid)
+	}
+	r.mu.Unlock()
+	if ok {
+		ch <- childExit{ExitCode: exitCode, Err: err}
+	}
+}
+
+// runAndCollect starts cmd, captures its combined stdout/stderr, and waits
+// for it via waitForExit instead of cmd.Wait()/CombinedOutput()'s own
+// internal Wait(). Every exec.Cmd this package starts - compile steps,
+// `docker kill`, dependency installers, not just the ones that reach
+// runCommandWithDetection - must collect its exit through the same path the
+// subreaper's SIGCHLD loop uses; otherwise the loop's indiscriminate
+// wait4(-1, ...) can win the race against a command's own Wait() and leave
+// it with ECHILD.
+// The output goes through an *os.File pipe read here to EOF: a non-file
+// Stdout would be filled by an exec copy goroutine that only cmd.Wait()
+// waits for.
+func runAndCollect(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	err = cmd.Start()
+	pw.Close()
+	if err != nil {
+		return nil, err
+	}
+	exit := waitForExit(ctx, cmd)
+	out, _ := io.ReadAll(pr)
+	return out, <-exit
+}
@@ -0,0 +1,76 @@
+// path: reaper_linux.go
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startReaper marks this process as a Linux subreaper so orphaned
+// grandchildren (interpreters that double-fork, daemonizing servers started
+// from user code, etc.) are re-parented to us instead of init, then reaps
+// everything off one SIGCHLD-driven loop rather than a cmd.Wait() per
+// caller, which can miss a child that already escaped to a different
+// parent. Because wait4(-1, ...) reaps whatever child is collectible
+// system-wide, every exec.Cmd this package starts - compile steps, docker
+// kill, dependency installers, not just the ones run through
+// runCommandWithDetection - must go through runAndCollect/waitForExit so
+// this loop never wins the race against an internal cmd.Wait() and leaves
+// it with ECHILD.
+func startReaper() {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ could not become a subreaper: %v\n", err)
+	}
+
+	sigchld := make(chan os.Signal, 64)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	go func() {
+		for range sigchld {
+			reapAvailable()
+		}
+	}()
+}
+
+// reapAvailable drains every child currently collectible with WNOHANG,
+// publishing each one's exit status to globalReaper.
+func reapAvailable() {
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return
+		}
+		globalReaper.publish(pid, ws.ExitStatus(), nil)
+	}
+}
+
+// waitForExit reports cmd's termination via the global reaper instead of
+// cmd.Wait(), so run_code's own child is collected by the same SIGCHLD loop
+// as any orphan it leaks.
+func waitForExit(ctx context.Context, cmd *exec.Cmd) <-chan error {
+	done := make(chan error, 1)
+	exit := globalReaper.register(cmd.Process.Pid)
+	go func() {
+		select {
+		case e := <-exit:
+			if e.Err != nil {
+				done <- e.Err
+			} else if e.ExitCode != 0 {
+				done <- fmt.Errorf("exit status %d", e.ExitCode)
+			} else {
+				done <- nil
+			}
+		case <-ctx.Done():
+			done <- fmt.Errorf("context cancelled")
+		}
+	}()
+	return done
+}
@@ -0,0 +1,29 @@
+// path: reaper_other.go
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// startReaper is a no-op outside Linux: PR_SET_CHILD_SUBREAPER has no
+// equivalent here, so orphaned grandchildren fall back to the OS's default
+// reparenting behavior instead of being collected by us.
+func startReaper() {}
+
+// waitForExit falls back to cmd.Wait() directly since there is no central
+// reaper collecting exits on this platform.
+func waitForExit(ctx context.Context, cmd *exec.Cmd) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		select {
+		case done <- cmd.Wait():
+		case <-ctx.Done():
+			done <- fmt.Errorf("context cancelled")
+		}
+	}()
+	return done
+}